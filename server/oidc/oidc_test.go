@@ -0,0 +1,290 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID     = "test-client"
+	testClientSecret = "test-secret"
+	testKeyID        = "test-key"
+)
+
+// testProvider is a minimal OIDC provider backed by httptest: discovery
+// document, token endpoint, and JWKS. Its ID tokens are real RS256 JWTs
+// signed by key, so Authenticator exercises the same signature
+// verification path it would against a real IDP.
+type testProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// nextIDTokenClaims is marshalled into the ID token returned by the
+	// next /token request.
+	nextIDTokenClaims map[string]interface{}
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating rsa key: %v", err)
+	}
+	p := &testProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]interface{}{
+				{
+					"kty": "RSA",
+					"use": "sig",
+					"alg": "RS256",
+					"kid": testKeyID,
+					"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(bigEndianUint(uint(key.PublicKey.E))),
+				},
+			},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idToken, err := p.signIDToken(p.nextIDTokenClaims)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "test-access-token",
+			"token_type":   "Bearer",
+			"id_token":     idToken,
+		})
+	})
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// claimsFor returns the standard claim set for a test ID token, with
+// nonce set to whatever BeginAuth generated for the in-flight flow.
+func (p *testProvider) claimsFor(nonce string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   p.server.URL,
+		"sub":   "user-1",
+		"aud":   testClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"email": "user@example.com",
+		"name":  "Test User",
+		"nonce": nonce,
+	}
+}
+
+func (p *testProvider) signIDToken(claims map[string]interface{}) (string, error) {
+	header := map[string]interface{}{"alg": "RS256", "typ": "JWT", "kid": testKeyID}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	hashed := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func bigEndianUint(v uint) []byte {
+	var b []byte
+	for v > 0 {
+		b = append([]byte{byte(v & 0xff)}, b...)
+		v >>= 8
+	}
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	return b
+}
+
+func newTestAuthenticator(t *testing.T, provider *testProvider) *authenticator {
+	t.Helper()
+	a, err := NewAuthenticator(context.Background(), provider.server.URL, testClientID, testClientSecret, "https://fleet.example.com/callback")
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+	return a.(*authenticator)
+}
+
+func TestBeginAuthGeneratesPKCEAndNonce(t *testing.T) {
+	provider := newTestProvider(t)
+	a := newTestAuthenticator(t, provider)
+
+	redirectURL, err := a.BeginAuth("state-1")
+	if err != nil {
+		t.Fatalf("BeginAuth: %v", err)
+	}
+	if !strings.Contains(redirectURL, "code_challenge=") || !strings.Contains(redirectURL, "code_challenge_method=S256") {
+		t.Errorf("redirect url missing PKCE params: %s", redirectURL)
+	}
+	if !strings.Contains(redirectURL, "nonce=") {
+		t.Errorf("redirect url missing nonce param: %s", redirectURL)
+	}
+
+	a.mu.Lock()
+	pending, ok := a.pending["state-1"]
+	a.mu.Unlock()
+	if !ok {
+		t.Fatal("BeginAuth did not record a pending entry for its state")
+	}
+	if pending.codeVerifier == "" || pending.nonce == "" {
+		t.Error("pending entry missing codeVerifier or nonce")
+	}
+}
+
+func TestExchangeCodeValidatesNonceAndReturnsIdentity(t *testing.T) {
+	provider := newTestProvider(t)
+	a := newTestAuthenticator(t, provider)
+
+	redirectURL, err := a.BeginAuth("state-1")
+	if err != nil {
+		t.Fatalf("BeginAuth: %v", err)
+	}
+	_ = redirectURL
+
+	a.mu.Lock()
+	nonce := a.pending["state-1"].nonce
+	a.mu.Unlock()
+	provider.nextIDTokenClaims = provider.claimsFor(nonce)
+
+	identity, err := a.ExchangeCode(context.Background(), "test-code", "state-1")
+	if err != nil {
+		t.Fatalf("ExchangeCode: %v", err)
+	}
+	if identity.UserID() != "user-1" {
+		t.Errorf("UserID() = %q, want %q", identity.UserID(), "user-1")
+	}
+	if identity.UserDisplayName() != "Test User" {
+		t.Errorf("UserDisplayName() = %q, want %q", identity.UserDisplayName(), "Test User")
+	}
+
+	// The state was consumed by the successful exchange above.
+	if _, err := a.ExchangeCode(context.Background(), "test-code", "state-1"); err == nil {
+		t.Error("ExchangeCode with an already-consumed state should fail")
+	}
+}
+
+func TestExchangeCodeRejectsNonceMismatch(t *testing.T) {
+	provider := newTestProvider(t)
+	a := newTestAuthenticator(t, provider)
+
+	if _, err := a.BeginAuth("state-1"); err != nil {
+		t.Fatalf("BeginAuth: %v", err)
+	}
+	provider.nextIDTokenClaims = provider.claimsFor("wrong-nonce")
+
+	if _, err := a.ExchangeCode(context.Background(), "test-code", "state-1"); err == nil {
+		t.Error("ExchangeCode should reject an ID token whose nonce doesn't match the request")
+	}
+}
+
+func TestExchangeCodeRejectsUnknownState(t *testing.T) {
+	provider := newTestProvider(t)
+	a := newTestAuthenticator(t, provider)
+
+	if _, err := a.ExchangeCode(context.Background(), "test-code", "never-issued"); err == nil {
+		t.Error("ExchangeCode with an unknown state should fail to correlate")
+	}
+}
+
+func TestExchangeCodeRejectsExpiredState(t *testing.T) {
+	provider := newTestProvider(t)
+	a := newTestAuthenticator(t, provider)
+
+	if _, err := a.BeginAuth("state-1"); err != nil {
+		t.Fatalf("BeginAuth: %v", err)
+	}
+
+	a.mu.Lock()
+	pending := a.pending["state-1"]
+	pending.startedAt = time.Now().Add(-pendingAuthTTL - time.Minute)
+	a.pending["state-1"] = pending
+	a.mu.Unlock()
+
+	provider.nextIDTokenClaims = provider.claimsFor(pending.nonce)
+	if _, err := a.ExchangeCode(context.Background(), "test-code", "state-1"); err == nil {
+		t.Error("ExchangeCode with an expired state should fail to correlate")
+	}
+}
+
+func TestValidateIDTokenRejectsBadSignature(t *testing.T) {
+	provider := newTestProvider(t)
+	a := newTestAuthenticator(t, provider)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating rsa key: %v", err)
+	}
+	forged := &testProvider{server: provider.server, key: otherKey}
+	rawIDToken, err := forged.signIDToken(provider.claimsFor("irrelevant"))
+	if err != nil {
+		t.Fatalf("signing forged id token: %v", err)
+	}
+
+	if _, err := a.ValidateIDToken(context.Background(), rawIDToken); err == nil {
+		t.Error("ValidateIDToken should reject an id token signed by a key not in the provider's JWKS")
+	}
+}
+
+func TestGeneratePKCE(t *testing.T) {
+	verifier, challenge, err := generatePKCE()
+	if err != nil {
+		t.Fatalf("generatePKCE: %v", err)
+	}
+	if len(verifier) == 0 || len(challenge) == 0 {
+		t.Fatal("generatePKCE returned an empty verifier or challenge")
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	want := base64.RawURLEncoding.EncodeToString(sum[:])
+	if challenge != want {
+		t.Errorf("challenge = %q, want S256(verifier) = %q", challenge, want)
+	}
+}
+
+func TestRandomStringIsUnique(t *testing.T) {
+	a, err := randomString(32)
+	if err != nil {
+		t.Fatalf("randomString: %v", err)
+	}
+	b, err := randomString(32)
+	if err != nil {
+		t.Fatalf("randomString: %v", err)
+	}
+	if a == b {
+		t.Error("randomString produced the same value twice in a row")
+	}
+}
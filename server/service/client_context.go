@@ -0,0 +1,55 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AuthenticatedDoContext is the context-aware counterpart to
+// AuthenticatedDo. Unlike a wrapper that races ctx.Done() against a
+// goroutine running the blocking call, it builds the request with
+// http.NewRequestWithContext so the transport itself aborts the round
+// trip — and releases the underlying connection — as soon as ctx is
+// done, instead of leaking a goroutine and an in-flight request.
+func (c *Client) AuthenticatedDoContext(ctx context.Context, verb, path, query string, params interface{}) (*http.Response, error) {
+	var body io.Reader
+	if params != nil {
+		bodyBytes, err := json.Marshal(params)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshaling json")
+		}
+		body = bytes.NewBuffer(bodyBytes)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, verb, c.url(path, query).String(), body)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating request object")
+	}
+	if params != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
+
+	return c.Do(request)
+}
+
+// WithTimeout returns a context bounded by timeout, along with its cancel
+// function, for callers of the *Context Client methods that would rather
+// not build their own context.
+func (c *Client) WithTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// SetDeadline returns a context bounded by deadline, along with its
+// cancel function, for callers of the *Context Client methods that would
+// rather not build their own context.
+func (c *Client) SetDeadline(deadline time.Time) (context.Context, context.CancelFunc) {
+	return context.WithDeadline(context.Background(), deadline)
+}
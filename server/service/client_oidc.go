@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+type beginOIDCResponse struct {
+	RedirectURL string `json:"redirect_url"`
+	Err         error  `json:"error,omitempty"`
+}
+
+// BeginOIDC starts the OIDC authorization code flow, returning the URL
+// the caller should open to authenticate with the configured provider.
+func (c *Client) BeginOIDC() (string, error) {
+	return c.BeginOIDCContext(context.Background())
+}
+
+// BeginOIDCContext is BeginOIDC with a caller-supplied context. The
+// request is abandoned if ctx is done before the server responds.
+func (c *Client) BeginOIDCContext(ctx context.Context) (string, error) {
+	verb, path := "GET", "/api/v1/kolide/sso/oidc"
+	response, err := c.AuthenticatedDoContext(ctx, verb, path, "", nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "%s %s", verb, path)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", errors.Errorf(
+			"begin oidc received status %d %s",
+			response.StatusCode,
+			extractServerErrorText(response.Body),
+		)
+	}
+
+	var responseBody beginOIDCResponse
+	err = json.NewDecoder(response.Body).Decode(&responseBody)
+	if err != nil {
+		return "", errors.Wrap(err, "decode begin oidc response")
+	}
+
+	if responseBody.Err != nil {
+		return "", errors.Errorf("begin oidc: %s", responseBody.Err)
+	}
+
+	return responseBody.RedirectURL, nil
+}
+
+type callbackOIDCRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+type callbackOIDCResponse struct {
+	Token string `json:"token"`
+	Err   error  `json:"error,omitempty"`
+}
+
+// CallbackOIDC completes the authorization code flow for the code/state
+// pair returned by the provider, returning a Fleet session token.
+func (c *Client) CallbackOIDC(code, state string) (string, error) {
+	return c.CallbackOIDCContext(context.Background(), code, state)
+}
+
+// CallbackOIDCContext is CallbackOIDC with a caller-supplied context. The
+// request is abandoned if ctx is done before the server responds.
+func (c *Client) CallbackOIDCContext(ctx context.Context, code, state string) (string, error) {
+	verb, path := "POST", "/api/v1/kolide/sso/oidc/callback"
+	response, err := c.AuthenticatedDoContext(ctx, verb, path, "", callbackOIDCRequest{Code: code, State: state})
+	if err != nil {
+		return "", errors.Wrapf(err, "%s %s", verb, path)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", errors.Errorf(
+			"callback oidc received status %d %s",
+			response.StatusCode,
+			extractServerErrorText(response.Body),
+		)
+	}
+
+	var responseBody callbackOIDCResponse
+	err = json.NewDecoder(response.Body).Decode(&responseBody)
+	if err != nil {
+		return "", errors.Wrap(err, "decode callback oidc response")
+	}
+
+	if responseBody.Err != nil {
+		return "", errors.Errorf("callback oidc: %s", responseBody.Err)
+	}
+
+	return responseBody.Token, nil
+}
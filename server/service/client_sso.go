@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+type logoutRequest struct {
+	SessionID uint `json:"session_id"`
+}
+
+type logoutResponse struct {
+	Err error `json:"error,omitempty"`
+}
+
+// Logout terminates the Fleet session identified by id, initiating a SAML
+// Single Logout round-trip with the IDP when the session was established
+// via SSO.
+func (c *Client) Logout(id uint) error {
+	return c.LogoutContext(context.Background(), id)
+}
+
+// LogoutContext is Logout with a caller-supplied context. The request is
+// abandoned if ctx is done before the server responds.
+func (c *Client) LogoutContext(ctx context.Context, id uint) error {
+	verb, path := "POST", "/api/v1/kolide/sso/logout"
+	response, err := c.AuthenticatedDoContext(ctx, verb, path, "", logoutRequest{SessionID: id})
+	if err != nil {
+		return errors.Wrapf(err, "%s %s", verb, path)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return errors.Errorf(
+			"logout received status %d %s",
+			response.StatusCode,
+			extractServerErrorText(response.Body),
+		)
+	}
+
+	var responseBody logoutResponse
+	err = json.NewDecoder(response.Body).Decode(&responseBody)
+	if err != nil {
+		return errors.Wrap(err, "decode logout response")
+	}
+
+	if responseBody.Err != nil {
+		return errors.Errorf("logout: %s", responseBody.Err)
+	}
+
+	return nil
+}
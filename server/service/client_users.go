@@ -1,17 +1,26 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/fleetdm/fleet/server/kolide"
 	"github.com/pkg/errors"
 	"net/http"
+	"net/url"
+	"strconv"
 )
 
 // CreateUser creates a new user, skipping the invitation process.
 func (c *Client) CreateUser(p kolide.UserPayload) error {
+	return c.CreateUserContext(context.Background(), p)
+}
+
+// CreateUserContext is CreateUser with a caller-supplied context. The
+// request is abandoned if ctx is done before the server responds.
+func (c *Client) CreateUserContext(ctx context.Context, p kolide.UserPayload) error {
 	verb, path := "POST", "/api/v1/kolide/users/admin"
-	response, err := c.AuthenticatedDo(verb, path, "", p)
+	response, err := c.AuthenticatedDoContext(ctx, verb, path, "", p)
 	if err != nil {
 		return errors.Wrapf(err, "%s %s", verb, path)
 	}
@@ -40,8 +49,14 @@ func (c *Client) CreateUser(p kolide.UserPayload) error {
 
 // GetUser retrieves information about a user
 func (c *Client) GetUser(id uint) (*kolide.User, error) {
+	return c.GetUserContext(context.Background(), id)
+}
+
+// GetUserContext is GetUser with a caller-supplied context. The request
+// is abandoned if ctx is done before the server responds.
+func (c *Client) GetUserContext(ctx context.Context, id uint) (*kolide.User, error) {
 	verb, path := "GET", fmt.Sprintf("/api/v1/kolide/users/%d", id)
-	response, err := c.AuthenticatedDo(verb, path, "", nil)
+	response, err := c.AuthenticatedDoContext(ctx, verb, path, "", nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "GET /api/v1/kolide/users")
 	}
@@ -72,11 +87,135 @@ func (c *Client) GetUser(id uint) (*kolide.User, error) {
 	return responseBody.User, nil
 }
 
-// ListUsers retrieves the list of all Users.
+// BulkUserResult reports the outcome of creating or upserting a single
+// user as part of a CreateUsers call.
+type BulkUserResult struct {
+	Email string `json:"email"`
+	ID    uint   `json:"id,omitempty"`
+	Err   string `json:"error,omitempty"`
+}
+
+type createUsersResponse struct {
+	Results []BulkUserResult `json:"results"`
+	Err     error            `json:"error,omitempty"`
+}
+
+// CreateUsers creates many users in a single request. The server performs
+// the creations inside one transaction and reports a per-user result
+// rather than failing the whole batch on the first error. When upsert is
+// true, a payload whose email matches an existing user updates that user
+// instead of failing.
+func (c *Client) CreateUsers(payloads []kolide.UserPayload, upsert bool) ([]BulkUserResult, error) {
+	return c.CreateUsersContext(context.Background(), payloads, upsert)
+}
+
+// CreateUsersContext is CreateUsers with a caller-supplied context. The
+// request is abandoned if ctx is done before the server responds.
+func (c *Client) CreateUsersContext(ctx context.Context, payloads []kolide.UserPayload, upsert bool) ([]BulkUserResult, error) {
+	verb, path := "POST", "/api/v1/kolide/users/admin/bulk"
+	query := ""
+	if upsert {
+		query = "upsert=true"
+	}
+	// The body is a bare JSON array, not a wrapping object: the server
+	// also accepts newline-delimited JSON from SCIM-style provisioning
+	// scripts that never produce an array, so there's no request struct
+	// for either format to share.
+	response, err := c.AuthenticatedDoContext(ctx, verb, path, query, payloads)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s %s", verb, path)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.Errorf(
+			"create users received status %d %s",
+			response.StatusCode,
+			extractServerErrorText(response.Body),
+		)
+	}
+
+	var responseBody createUsersResponse
+	err = json.NewDecoder(response.Body).Decode(&responseBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode create users response")
+	}
+
+	if responseBody.Err != nil {
+		return nil, errors.Errorf("create users: %s", responseBody.Err)
+	}
+
+	return responseBody.Results, nil
+}
+
+// ListUsersOptions controls pagination, ordering, and server-side search
+// and filtering for ListUsers.
+type ListUsersOptions struct {
+	Page           int
+	PerPage        int
+	Query          string
+	OrderBy        string
+	OrderDirection string
+	TeamID         uint
+}
+
+func (o ListUsersOptions) queryString() string {
+	query := url.Values{}
+	if o.Page > 0 {
+		query.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.PerPage > 0 {
+		query.Set("per_page", strconv.Itoa(o.PerPage))
+	}
+	if o.Query != "" {
+		query.Set("query", o.Query)
+	}
+	if o.OrderBy != "" {
+		query.Set("order_key", o.OrderBy)
+	}
+	if o.OrderDirection != "" {
+		query.Set("order_direction", o.OrderDirection)
+	}
+	if o.TeamID != 0 {
+		query.Set("team_id", strconv.FormatUint(uint64(o.TeamID), 10))
+	}
+	return query.Encode()
+}
+
+// ListUsersResponse is a single page of ListUsers results.
+type ListUsersResponse struct {
+	Users      []kolide.User `json:"users"`
+	TotalCount int           `json:"total_count"`
+	NextPage   int           `json:"next_page,omitempty"`
+	Err        error         `json:"error,omitempty"`
+}
+
+// ListUsers retrieves all users, paging through them with ListUsersIter.
 func (c *Client) ListUsers() ([]kolide.User, error) {
-	response, err := c.AuthenticatedDo("GET", "/api/v1/kolide/users", "", nil)
+	var users []kolide.User
+	iter := c.ListUsersIter(ListUsersOptions{})
+	for iter.Next() {
+		users = append(users, iter.User())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ListUsersWithOptions retrieves a page of Users matching opts.
+func (c *Client) ListUsersWithOptions(opts ListUsersOptions) (*ListUsersResponse, error) {
+	return c.ListUsersWithOptionsContext(context.Background(), opts)
+}
+
+// ListUsersWithOptionsContext is ListUsersWithOptions with a
+// caller-supplied context. The request is abandoned if ctx is done before
+// the server responds.
+func (c *Client) ListUsersWithOptionsContext(ctx context.Context, opts ListUsersOptions) (*ListUsersResponse, error) {
+	verb, path := "GET", "/api/v1/kolide/users"
+	response, err := c.AuthenticatedDoContext(ctx, verb, path, opts.queryString(), nil)
 	if err != nil {
-		return nil, errors.Wrap(err, "GET /api/v1/kolide/users")
+		return nil, errors.Wrapf(err, "%s %s", verb, path)
 	}
 	defer response.Body.Close()
 
@@ -88,7 +227,7 @@ func (c *Client) ListUsers() ([]kolide.User, error) {
 		)
 	}
 
-	var responseBody listUsersResponse
+	var responseBody ListUsersResponse
 	err = json.NewDecoder(response.Body).Decode(&responseBody)
 	if err != nil {
 		return nil, errors.Wrap(err, "decode list users response")
@@ -98,5 +237,82 @@ func (c *Client) ListUsers() ([]kolide.User, error) {
 		return nil, errors.Errorf("list users: %s", responseBody.Err)
 	}
 
-	return responseBody.Users, nil
+	return &responseBody, nil
+}
+
+// ListUsersIter pages through ListUsers results transparently, fetching
+// the next page only once the caller has consumed the current one.
+type ListUsersIter struct {
+	client *Client
+	ctx    context.Context
+	opts   ListUsersOptions
+
+	page      []kolide.User
+	pos       int
+	current   kolide.User
+	exhausted bool
+	err       error
+}
+
+// ListUsersIter returns an iterator over all users matching opts, fetched
+// PerPage (default 100) users at a time. opts.Page is ignored and managed
+// internally by the iterator.
+func (c *Client) ListUsersIter(opts ListUsersOptions) *ListUsersIter {
+	if opts.PerPage == 0 {
+		opts.PerPage = 100
+	}
+	opts.Page = 0
+	return &ListUsersIter{client: c, ctx: context.Background(), opts: opts, pos: -1}
+}
+
+// Next advances the iterator, fetching the next page from the server as
+// needed. It returns false once iteration is complete or an error has
+// occurred; callers should check Err after Next returns false.
+func (it *ListUsersIter) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.pos++
+	for it.pos >= len(it.page) {
+		if it.exhausted {
+			return false
+		}
+		response, err := it.client.ListUsersWithOptionsContext(it.ctx, it.opts)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page = response.Users
+		it.pos = 0
+		nextPage, exhausted := nextPageParams(response)
+		it.exhausted = exhausted
+		if !exhausted {
+			it.opts.Page = nextPage
+		}
+		if len(it.page) == 0 {
+			return false
+		}
+	}
+	it.current = it.page[it.pos]
+	return true
+}
+
+// nextPageParams determines a ListUsersIter's next fetch state from a page
+// response: the Page to request next, and whether no further pages remain.
+func nextPageParams(resp *ListUsersResponse) (nextPage int, exhausted bool) {
+	if resp.NextPage == 0 || len(resp.Users) == 0 {
+		return 0, true
+	}
+	return resp.NextPage, false
+}
+
+// User returns the user at the iterator's current position. It is only
+// valid after a call to Next that returned true.
+func (it *ListUsersIter) User() kolide.User {
+	return it.current
+}
+
+// Err returns the first error encountered while paging, if any.
+func (it *ListUsersIter) Err() error {
+	return it.err
 }
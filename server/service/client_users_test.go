@@ -0,0 +1,86 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/fleetdm/fleet/server/kolide"
+)
+
+func TestNextPageParams(t *testing.T) {
+	cases := []struct {
+		name          string
+		resp          *ListUsersResponse
+		wantNextPage  int
+		wantExhausted bool
+	}{
+		{
+			name:          "next page available",
+			resp:          &ListUsersResponse{Users: []kolide.User{{}}, NextPage: 2},
+			wantNextPage:  2,
+			wantExhausted: false,
+		},
+		{
+			name:          "no next page",
+			resp:          &ListUsersResponse{Users: []kolide.User{{}}, NextPage: 0},
+			wantNextPage:  0,
+			wantExhausted: true,
+		},
+		{
+			name:          "empty page",
+			resp:          &ListUsersResponse{Users: nil, NextPage: 3},
+			wantNextPage:  0,
+			wantExhausted: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			nextPage, exhausted := nextPageParams(c.resp)
+			if nextPage != c.wantNextPage {
+				t.Errorf("nextPage = %d, want %d", nextPage, c.wantNextPage)
+			}
+			if exhausted != c.wantExhausted {
+				t.Errorf("exhausted = %v, want %v", exhausted, c.wantExhausted)
+			}
+		})
+	}
+}
+
+func TestListUsersOptionsQueryString(t *testing.T) {
+	cases := []struct {
+		name string
+		opts ListUsersOptions
+		want string
+	}{
+		{
+			name: "zero value",
+			opts: ListUsersOptions{},
+			want: "",
+		},
+		{
+			name: "page and per page",
+			opts: ListUsersOptions{Page: 2, PerPage: 50},
+			want: "page=2&per_page=50",
+		},
+		{
+			name: "all fields",
+			opts: ListUsersOptions{
+				Page:           1,
+				PerPage:        10,
+				Query:          "jane",
+				OrderBy:        "name",
+				OrderDirection: "desc",
+				TeamID:         7,
+			},
+			want: "order_direction=desc&order_key=name&page=1&per_page=10&query=jane&team_id=7",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.opts.queryString(); got != c.want {
+				t.Errorf("queryString() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
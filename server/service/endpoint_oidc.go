@@ -0,0 +1,78 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	fleetoidc "github.com/kolide/fleet/server/oidc"
+	"github.com/pkg/errors"
+)
+
+// SessionIssuer mints a Fleet session token for a successfully
+// authenticated identity, regardless of whether it came from SAML or
+// OIDC.
+type SessionIssuer interface {
+	// IssueSessionToken provisions (or updates) the Fleet user identified
+	// by userID/displayName and returns a session token for them.
+	IssueSessionToken(userID, displayName string) (token string, err error)
+}
+
+// MakeBeginOIDCHandler implements GET /api/v1/kolide/sso/oidc: it returns
+// the URL the caller's browser should be redirected to in order to begin
+// the OIDC authorization code flow.
+func MakeBeginOIDCHandler(auth fleetoidc.Authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, err := generateOIDCState()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, beginOIDCResponse{Err: errors.Wrap(err, "generating state")})
+			return
+		}
+
+		redirectURL, err := auth.BeginAuth(state)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, beginOIDCResponse{Err: err})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, beginOIDCResponse{RedirectURL: redirectURL})
+	})
+}
+
+// MakeCallbackOIDCHandler implements POST /api/v1/kolide/sso/oidc/callback:
+// it completes the authorization code flow for the code/state pair the
+// provider's redirect returned, and provisions a Fleet session for the
+// authenticated identity.
+func MakeCallbackOIDCHandler(auth fleetoidc.Authenticator, sessions SessionIssuer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req callbackOIDCRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, callbackOIDCResponse{Err: errors.Wrap(err, "decode callback request")})
+			return
+		}
+
+		identity, err := auth.ExchangeCode(r.Context(), req.Code, req.State)
+		if err != nil {
+			writeJSON(w, http.StatusUnauthorized, callbackOIDCResponse{Err: err})
+			return
+		}
+
+		token, err := sessions.IssueSessionToken(identity.UserID(), identity.UserDisplayName())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, callbackOIDCResponse{Err: errors.Wrap(err, "issuing session")})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, callbackOIDCResponse{Token: token})
+	})
+}
+
+// generateOIDCState returns an unguessable state parameter for BeginAuth.
+func generateOIDCState() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	fleetsso "github.com/kolide/fleet/server/sso"
+	"github.com/pkg/errors"
+)
+
+// SessionStore is the slice of the Fleet datastore the SSO logout
+// endpoint needs.
+type SessionStore interface {
+	// SSOSessionByID returns the NameID, NameID Format, and SessionIndex
+	// recorded for a SAML-backed Fleet session. ok is false for a
+	// session that wasn't established via SSO.
+	SSOSessionByID(id uint) (nameID, nameIDFormat, sessionIndex string, ok bool, err error)
+	// DestroySession deletes the Fleet session with the given ID.
+	DestroySession(id uint) error
+}
+
+// MakeLogoutHandler implements POST /api/v1/kolide/sso/logout: it
+// terminates the named Fleet session and, for an SSO-backed session,
+// also initiates a SAML Single Logout round-trip with the IDP via
+// logout's HTTP-POST binding so the IDP's own session is torn down too.
+// The IDP round-trip is best-effort: the Fleet session above is already
+// gone by the time it's attempted, so a failure there doesn't stop the
+// caller from being signed out of Fleet.
+func MakeLogoutHandler(sessions SessionStore, logout fleetsso.LogoutHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req logoutRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, logoutResponse{Err: errors.Wrap(err, "decode logout request")})
+			return
+		}
+
+		nameID, nameIDFormat, sessionIndex, ok, err := sessions.SSOSessionByID(req.SessionID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, logoutResponse{Err: errors.Wrap(err, "looking up session")})
+			return
+		}
+
+		if err := sessions.DestroySession(req.SessionID); err != nil {
+			writeJSON(w, http.StatusInternalServerError, logoutResponse{Err: errors.Wrap(err, "terminating session")})
+			return
+		}
+
+		if ok {
+			// Best-effort: the local session is already destroyed above,
+			// so a failure to round-trip with the IDP doesn't change the
+			// result the caller sees.
+			_ = logout.Logout(nameID, nameIDFormat, sessionIndex)
+		}
+
+		writeJSON(w, http.StatusOK, logoutResponse{})
+	})
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/fleetdm/fleet/server/kolide"
+	"github.com/pkg/errors"
+)
+
+// UserProvisioner is the slice of the Fleet datastore the bulk user
+// provisioning endpoint needs.
+type UserProvisioner interface {
+	// WithTx runs fn inside a single transaction, rolling back and
+	// returning fn's error if it returns one.
+	WithTx(fn func(tx UserTx) error) error
+}
+
+// UserTx is the transactional handle WithTx hands to its callback: the
+// per-user operation CreateUsers performs for each payload in a batch.
+type UserTx interface {
+	// CreateOrUpsertUser creates a user from p. If upsert is true and a
+	// user with p's email already exists, that user is updated instead
+	// of failing.
+	CreateOrUpsertUser(p kolide.UserPayload, upsert bool) (*kolide.User, error)
+}
+
+// MakeCreateUsersHandler implements POST
+// /api/v1/kolide/users/admin/bulk: it creates every user in the batch
+// inside a single transaction, reporting a per-user result rather than
+// failing the whole batch on the first error. The body may be a JSON
+// array of kolide.UserPayload or newline-delimited JSON, matching the
+// formats SCIM-style provisioning scripts commonly produce. upsert=true
+// in the query string updates an existing user matched by email instead
+// of failing that user's entry.
+func MakeCreateUsersHandler(store UserProvisioner) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payloads, err := decodeUserPayloads(r.Body)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, createUsersResponse{Err: errors.Wrap(err, "decode create users request")})
+			return
+		}
+
+		upsert, err := parseUpsertQuery(r.URL.Query().Get("upsert"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, createUsersResponse{Err: errors.Wrap(err, "parsing upsert")})
+			return
+		}
+
+		results := make([]BulkUserResult, len(payloads))
+		err = store.WithTx(func(tx UserTx) error {
+			for i, payload := range payloads {
+				results[i] = createOrUpsertUserResult(tx, payload, upsert)
+			}
+			return nil
+		})
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, createUsersResponse{Err: errors.Wrap(err, "provisioning users")})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, createUsersResponse{Results: results})
+	})
+}
+
+// decodeUserPayloads reads either a JSON array of kolide.UserPayload or a
+// stream of newline-delimited JSON objects from body. The two formats are
+// told apart by the first non-whitespace byte: '[' is a JSON array,
+// anything else is decoded as a sequence of concatenated JSON values,
+// which is what json.Decoder.Decode already does with NDJSON input.
+func decodeUserPayloads(body io.Reader) ([]kolide.UserPayload, error) {
+	reader := bufio.NewReader(body)
+	first, err := peekNonWhitespace(reader)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "peeking request body")
+	}
+
+	if first == '[' {
+		var payloads []kolide.UserPayload
+		if err := json.NewDecoder(reader).Decode(&payloads); err != nil {
+			return nil, errors.Wrap(err, "decoding json array body")
+		}
+		return payloads, nil
+	}
+
+	var payloads []kolide.UserPayload
+	dec := json.NewDecoder(reader)
+	for {
+		var payload kolide.UserPayload
+		if err := dec.Decode(&payload); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "decoding newline-delimited json body")
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
+
+// peekNonWhitespace returns the first non-whitespace byte in r without
+// consuming anything beyond it, or io.EOF if r has no such byte.
+func peekNonWhitespace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\n', '\r':
+			if _, err := r.Discard(1); err != nil {
+				return 0, err
+			}
+		default:
+			return b[0], nil
+		}
+	}
+}
+
+// parseUpsertQuery parses the upsert query parameter, defaulting to false
+// when it's absent.
+func parseUpsertQuery(v string) (bool, error) {
+	if v == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+// createOrUpsertUserResult creates or upserts a single user and converts
+// the outcome into a BulkUserResult, rather than aborting the batch, so a
+// single bad payload doesn't fail users that were fine.
+func createOrUpsertUserResult(tx UserTx, payload kolide.UserPayload, upsert bool) BulkUserResult {
+	result := BulkUserResult{Email: payloadEmail(payload)}
+
+	user, err := tx.CreateOrUpsertUser(payload, upsert)
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+
+	result.ID = user.ID
+	return result
+}
+
+func payloadEmail(p kolide.UserPayload) string {
+	if p.Email == nil {
+		return ""
+	}
+	return *p.Email
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/fleetdm/fleet/server/kolide"
+	"github.com/pkg/errors"
+)
+
+// maxListUsersPerPage caps the page size a caller can request, so a
+// careless or malicious per_page value can't force this endpoint back
+// into returning an unbounded number of users in one response.
+const maxListUsersPerPage = 500
+
+// validOrderDirections are the order_direction values the datastore
+// understands; anything else is rejected rather than forwarded.
+var validOrderDirections = map[string]bool{
+	"":     true,
+	"asc":  true,
+	"desc": true,
+}
+
+// UserLister is the slice of the Fleet datastore the paginated ListUsers
+// endpoint needs.
+type UserLister interface {
+	// ListUsers returns a page of users matching the given pagination,
+	// ordering, search, and team filters, along with the total count of
+	// users matching the filters across all pages.
+	ListUsers(page, perPage int, query, orderBy, orderDirection string, teamID uint) (users []kolide.User, totalCount int, err error)
+}
+
+// MakeListUsersHandler implements GET /api/v1/kolide/users: it pages
+// through users matching the request's query parameters instead of
+// returning every user in one unbounded response.
+func MakeListUsersHandler(users UserLister) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		opts, err := parseListUsersQuery(r.URL.Query())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ListUsersResponse{Err: err})
+			return
+		}
+
+		results, total, err := users.ListUsers(opts.Page, opts.PerPage, opts.Query, opts.OrderBy, opts.OrderDirection, opts.TeamID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ListUsersResponse{Err: errors.Wrap(err, "listing users")})
+			return
+		}
+
+		resp := ListUsersResponse{Users: results, TotalCount: total}
+		if (opts.Page+1)*opts.PerPage < total {
+			resp.NextPage = opts.Page + 1
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+// parseListUsersQuery parses the query parameters ListUsersOptions.queryString
+// encodes on the client side back into a ListUsersOptions, defaulting
+// PerPage the same way ListUsersIter does.
+func parseListUsersQuery(query url.Values) (ListUsersOptions, error) {
+	opts := ListUsersOptions{
+		Query:          query.Get("query"),
+		OrderBy:        query.Get("order_key"),
+		OrderDirection: query.Get("order_direction"),
+	}
+
+	if v := query.Get("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil {
+			return ListUsersOptions{}, errors.Wrap(err, "parsing page")
+		}
+		if page < 0 {
+			return ListUsersOptions{}, errors.Errorf("page must not be negative: %d", page)
+		}
+		opts.Page = page
+	}
+
+	if v := query.Get("per_page"); v != "" {
+		perPage, err := strconv.Atoi(v)
+		if err != nil {
+			return ListUsersOptions{}, errors.Wrap(err, "parsing per_page")
+		}
+		opts.PerPage = perPage
+	}
+	if opts.PerPage <= 0 {
+		opts.PerPage = 100
+	}
+	if opts.PerPage > maxListUsersPerPage {
+		return ListUsersOptions{}, errors.Errorf("per_page must not exceed %d", maxListUsersPerPage)
+	}
+
+	if !validOrderDirections[opts.OrderDirection] {
+		return ListUsersOptions{}, errors.Errorf("unrecognized order_direction: %q", opts.OrderDirection)
+	}
+
+	if v := query.Get("team_id"); v != "" {
+		teamID, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return ListUsersOptions{}, errors.Wrap(err, "parsing team_id")
+		}
+		opts.TeamID = uint(teamID)
+	}
+
+	return opts, nil
+}
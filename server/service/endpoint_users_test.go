@@ -0,0 +1,166 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fleetdm/fleet/server/kolide"
+	"github.com/pkg/errors"
+)
+
+type fakeUserTx struct {
+	created []kolide.UserPayload
+	nextID  uint
+	failFor string // CreateOrUpsertUser fails when the payload's email equals this
+	upserts []bool // the upsert argument of each CreateOrUpsertUser call
+}
+
+func (tx *fakeUserTx) CreateOrUpsertUser(p kolide.UserPayload, upsert bool) (*kolide.User, error) {
+	tx.upserts = append(tx.upserts, upsert)
+	email := payloadEmail(p)
+	if email == tx.failFor {
+		return nil, errors.Errorf("creating user %s failed", email)
+	}
+	tx.created = append(tx.created, p)
+	tx.nextID++
+	return &kolide.User{ID: tx.nextID}, nil
+}
+
+type fakeUserProvisioner struct {
+	tx *fakeUserTx
+}
+
+func (p *fakeUserProvisioner) WithTx(fn func(tx UserTx) error) error {
+	return fn(p.tx)
+}
+
+func TestCreateUsersHandlerPartialSuccess(t *testing.T) {
+	store := &fakeUserProvisioner{tx: &fakeUserTx{failFor: "bad@example.com"}}
+	handler := MakeCreateUsersHandler(store)
+
+	body := `[{"email":"good@example.com"},{"email":"bad@example.com"}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/kolide/users/admin/bulk", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), `"email":"good@example.com","id":1`) {
+		t.Errorf("response missing successful result: %s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"email":"bad@example.com","error"`) {
+		t.Errorf("response missing failed result: %s", w.Body.String())
+	}
+}
+
+func TestCreateUsersHandlerAcceptsNDJSON(t *testing.T) {
+	store := &fakeUserProvisioner{tx: &fakeUserTx{}}
+	handler := MakeCreateUsersHandler(store)
+
+	body := "{\"email\":\"one@example.com\"}\n{\"email\":\"two@example.com\"}\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/kolide/users/admin/bulk", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if len(store.tx.created) != 2 {
+		t.Errorf("created %d users, want 2", len(store.tx.created))
+	}
+}
+
+func TestCreateUsersHandlerUpsertQueryParam(t *testing.T) {
+	var gotUpsert bool
+	store := &fakeUserProvisioner{tx: &fakeUserTx{}}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upsert, err := parseUpsertQuery(r.URL.Query().Get("upsert"))
+		if err != nil {
+			t.Fatalf("parseUpsertQuery: %v", err)
+		}
+		gotUpsert = upsert
+		MakeCreateUsersHandler(store).ServeHTTP(w, r)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/kolide/users/admin/bulk?upsert=true", strings.NewReader(`[{"email":"a@example.com"}]`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !gotUpsert {
+		t.Error("upsert=true in the query string should parse as true")
+	}
+	if len(store.tx.upserts) != 1 || !store.tx.upserts[0] {
+		t.Errorf("CreateOrUpsertUser upsert args = %v, want [true]", store.tx.upserts)
+	}
+}
+
+func TestCreateUsersHandlerRejectsMalformedBody(t *testing.T) {
+	store := &fakeUserProvisioner{tx: &fakeUserTx{}}
+	handler := MakeCreateUsersHandler(store)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/kolide/users/admin/bulk", strings.NewReader(`not json`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestDecodeUserPayloads(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"empty body", "", 0},
+		{"json array", `[{"email":"a@example.com"},{"email":"b@example.com"}]`, 2},
+		{"ndjson", "{\"email\":\"a@example.com\"}\n{\"email\":\"b@example.com\"}\n", 2},
+		{"ndjson no trailing newline", `{"email":"a@example.com"}`, 1},
+		{"leading whitespace array", "  \n[{\"email\":\"a@example.com\"}]", 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			payloads, err := decodeUserPayloads(strings.NewReader(c.body))
+			if err != nil {
+				t.Fatalf("decodeUserPayloads: %v", err)
+			}
+			if len(payloads) != c.want {
+				t.Errorf("decoded %d payloads, want %d", len(payloads), c.want)
+			}
+		})
+	}
+}
+
+func TestParseUpsertQuery(t *testing.T) {
+	cases := []struct {
+		v       string
+		want    bool
+		wantErr bool
+	}{
+		{"", false, false},
+		{"true", true, false},
+		{"false", false, false},
+		{"not-a-bool", false, true},
+	}
+
+	for _, c := range cases {
+		got, err := parseUpsertQuery(c.v)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parseUpsertQuery(%q) should have failed", c.v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseUpsertQuery(%q): %v", c.v, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("parseUpsertQuery(%q) = %v, want %v", c.v, got, c.want)
+		}
+	}
+}
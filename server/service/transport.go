@@ -0,0 +1,15 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// writeJSON encodes body as the JSON response for one of the package's
+// HTTP handlers, matching the response shapes the Client methods in this
+// package decode.
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,239 @@
+package sso
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/pkg/errors"
+)
+
+// XML-Enc key transport and block encryption algorithm identifiers
+// supported when decrypting <saml:EncryptedAssertion> elements.
+const (
+	algRSAOAEP = "http://www.w3.org/2001/04/xmlenc#rsa-oaep-mgf1p"
+	algRSA15   = "http://www.w3.org/2001/04/xmlenc#rsa-1_5"
+
+	algAES128CBC = "http://www.w3.org/2001/04/xmlenc#aes128-cbc"
+	algAES192CBC = "http://www.w3.org/2001/04/xmlenc#aes192-cbc"
+	algAES256CBC = "http://www.w3.org/2001/04/xmlenc#aes256-cbc"
+
+	algAES128GCM = "http://www.w3.org/2009/xmlenc11#aes128-gcm"
+	algAES192GCM = "http://www.w3.org/2009/xmlenc11#aes192-gcm"
+	algAES256GCM = "http://www.w3.org/2009/xmlenc11#aes256-gcm"
+)
+
+// errDecryptionFailed is returned for every RSA, AES, or padding failure
+// while decrypting an EncryptedAssertion. The key-transport and block
+// ciphertexts here are attacker-controlled (a forged SAML response), so
+// unlike the structural checks below, these failures deliberately carry
+// no further detail: distinguishing "bad RSA padding" from "bad AES
+// padding" from "bad GCM tag" would hand an attacker the oracle behind
+// the Bleichenbacher and XML-Enc CBC padding-oracle attacks.
+var errDecryptionFailed = errors.New("decryption failed")
+
+// blockKeySize returns the symmetric key size, in bytes, required by a
+// block encryption algorithm identifier.
+func blockKeySize(algorithm string) (int, bool) {
+	switch algorithm {
+	case algAES128CBC, algAES128GCM:
+		return 16, true
+	case algAES192CBC, algAES192GCM:
+		return 24, true
+	case algAES256CBC, algAES256GCM:
+		return 32, true
+	default:
+		return 0, false
+	}
+}
+
+// decryptAssertions replaces every <saml:EncryptedAssertion> in doc with
+// its decrypted <saml:Assertion>, in place. It is a no-op when the
+// response contains no encrypted assertions.
+func (v *validator) decryptAssertions(doc *etree.Document) error {
+	encryptedAssertions := doc.FindElements("//EncryptedAssertion")
+	if len(encryptedAssertions) == 0 {
+		return nil
+	}
+	if v.decryptionKey == nil {
+		return errors.New("no decryption key configured")
+	}
+	for _, encAssertion := range encryptedAssertions {
+		parent := encAssertion.Parent()
+		if parent == nil {
+			return errors.New("encrypted assertion has no parent element")
+		}
+		assertion, err := v.decryptAssertion(encAssertion)
+		if err != nil {
+			return errors.Wrap(err, "decryption failed")
+		}
+		parent.RemoveChild(encAssertion)
+		parent.AddChild(assertion)
+	}
+	return nil
+}
+
+func (v *validator) decryptAssertion(encAssertion *etree.Element) (*etree.Element, error) {
+	encData := encAssertion.FindElement(".//EncryptedData")
+	if encData == nil {
+		return nil, errors.New("missing EncryptedData element")
+	}
+	method := encData.FindElement("./EncryptionMethod")
+	if method == nil {
+		return nil, errors.New("missing EncryptionMethod on EncryptedData")
+	}
+	blockAlgorithm := method.SelectAttrValue("Algorithm", "")
+	keySize, ok := blockKeySize(blockAlgorithm)
+	if !ok {
+		return nil, errors.Errorf("unsupported block encryption algorithm %q", blockAlgorithm)
+	}
+
+	symmetricKey, err := v.decryptSymmetricKey(encData, keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := cipherValue(encData)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := decryptBlock(blockAlgorithm, symmetricKey, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	assertionDoc := etree.NewDocument()
+	if err := assertionDoc.ReadFromBytes(plaintext); err != nil || assertionDoc.Root() == nil {
+		return nil, errDecryptionFailed
+	}
+	return assertionDoc.Root(), nil
+}
+
+// decryptSymmetricKey decrypts the xenc:EncryptedKey nested in an
+// EncryptedData's KeyInfo using the SP's RSA private key. keySize is the
+// symmetric key length, in bytes, required by the EncryptedData's block
+// algorithm.
+func (v *validator) decryptSymmetricKey(encData *etree.Element, keySize int) ([]byte, error) {
+	encKey := encData.FindElement(".//EncryptedKey")
+	if encKey == nil {
+		return nil, errors.New("missing EncryptedKey element")
+	}
+	method := encKey.FindElement("./EncryptionMethod")
+	if method == nil {
+		return nil, errors.New("missing EncryptionMethod on EncryptedKey")
+	}
+	ciphertext, err := cipherValue(encKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch algorithm := method.SelectAttrValue("Algorithm", ""); algorithm {
+	case algRSAOAEP:
+		key, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, v.decryptionKey, ciphertext, nil)
+		if err != nil {
+			return nil, errDecryptionFailed
+		}
+		return key, nil
+	case algRSA15:
+		// key is pre-filled with keySize random bytes.
+		// DecryptPKCS1v15SessionKey overwrites it only when the padding
+		// is valid and otherwise leaves it unchanged, returning a nil
+		// error rather than reporting which check failed — exactly
+		// what's needed to keep an RSA-1_5 key transport failure from
+		// acting as a Bleichenbacher oracle.
+		key := make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, errDecryptionFailed
+		}
+		if err := rsa.DecryptPKCS1v15SessionKey(rand.Reader, v.decryptionKey, ciphertext, key); err != nil {
+			return nil, errDecryptionFailed
+		}
+		return key, nil
+	default:
+		return nil, errors.Errorf("unsupported key transport algorithm %q", algorithm)
+	}
+}
+
+func cipherValue(elt *etree.Element) ([]byte, error) {
+	cipherValueElt := elt.FindElement("./CipherData/CipherValue")
+	if cipherValueElt == nil {
+		return nil, errors.New("missing CipherData/CipherValue element")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(cipherValueElt.Text()))
+	if err != nil {
+		return nil, errors.Wrap(err, "base64 decoding cipher value")
+	}
+	return data, nil
+}
+
+func decryptBlock(algorithm string, key, ciphertext []byte) ([]byte, error) {
+	switch algorithm {
+	case algAES128CBC, algAES192CBC, algAES256CBC:
+		return decryptAESCBC(key, ciphertext)
+	case algAES128GCM, algAES192GCM, algAES256GCM:
+		return decryptAESGCM(key, ciphertext)
+	default:
+		return nil, errors.Errorf("unsupported block encryption algorithm %q", algorithm)
+	}
+}
+
+// decryptAESCBC expects the IV prepended to the ciphertext, as produced
+// by every XML-Enc implementation Fleet has encountered in the wild.
+func decryptAESCBC(key, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errDecryptionFailed
+	}
+	if len(ciphertext) < aes.BlockSize {
+		return nil, errDecryptionFailed
+	}
+	iv, data := ciphertext[:aes.BlockSize], ciphertext[aes.BlockSize:]
+	if len(data)%aes.BlockSize != 0 {
+		return nil, errDecryptionFailed
+	}
+	plaintext := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, data)
+	return pkcs7Unpad(plaintext)
+}
+
+// decryptAESGCM expects the nonce prepended to the ciphertext.
+func decryptAESGCM(key, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errDecryptionFailed
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errDecryptionFailed
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errDecryptionFailed
+	}
+	nonce, data := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, errDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+// pkcs7Unpad strips the padding whose length is given by the final byte of
+// data. It returns errDecryptionFailed, with no further detail, when that
+// length is zero or exceeds len(data), so that CBC decryption can't be used
+// as a padding oracle against the SP's key. The values of the other
+// padding bytes are not checked.
+func pkcs7Unpad(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errDecryptionFailed
+	}
+	padLen := int(data[len(data)-1])
+	if padLen == 0 || padLen > len(data) {
+		return nil, errDecryptionFailed
+	}
+	return data[:len(data)-padLen], nil
+}
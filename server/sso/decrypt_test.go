@@ -0,0 +1,178 @@
+package sso
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"testing"
+)
+
+func TestBlockKeySize(t *testing.T) {
+	cases := []struct {
+		algorithm string
+		wantSize  int
+		wantOK    bool
+	}{
+		{algAES128CBC, 16, true},
+		{algAES128GCM, 16, true},
+		{algAES192CBC, 24, true},
+		{algAES192GCM, 24, true},
+		{algAES256CBC, 32, true},
+		{algAES256GCM, 32, true},
+		{"unsupported-algorithm", 0, false},
+		{"", 0, false},
+	}
+
+	for _, c := range cases {
+		size, ok := blockKeySize(c.algorithm)
+		if size != c.wantSize || ok != c.wantOK {
+			t.Errorf("blockKeySize(%q) = (%d, %v), want (%d, %v)", c.algorithm, size, ok, c.wantSize, c.wantOK)
+		}
+	}
+}
+
+func TestDecryptBlockDispatch(t *testing.T) {
+	if _, err := decryptBlock("unsupported-algorithm", nil, nil); err == nil {
+		t.Error("decryptBlock with unsupported algorithm should return an error")
+	}
+
+	key := make([]byte, 16)
+	plaintext := []byte("hello world, this is a test")
+
+	t.Run("cbc round trip", func(t *testing.T) {
+		ciphertext := encryptAESCBCForTest(t, key, plaintext)
+		got, err := decryptBlock(algAES128CBC, key, ciphertext)
+		if err != nil {
+			t.Fatalf("decryptBlock: %v", err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("decryptBlock() = %q, want %q", got, plaintext)
+		}
+	})
+
+	t.Run("gcm round trip", func(t *testing.T) {
+		ciphertext := encryptAESGCMForTest(t, key, plaintext)
+		got, err := decryptBlock(algAES128GCM, key, ciphertext)
+		if err != nil {
+			t.Fatalf("decryptBlock: %v", err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("decryptBlock() = %q, want %q", got, plaintext)
+		}
+	})
+}
+
+// TestDecryptionFailuresAreIndistinguishable guards against regressing the
+// padding-oracle fix: every AES/padding failure mode must return the same
+// sentinel error, with no detail that would let an attacker distinguish a
+// bad tag from bad padding from a malformed ciphertext.
+func TestDecryptionFailuresAreIndistinguishable(t *testing.T) {
+	key := make([]byte, 16)
+
+	cases := []struct {
+		name       string
+		algorithm  string
+		ciphertext []byte
+	}{
+		{"cbc too short", algAES128CBC, make([]byte, aes.BlockSize-1)},
+		{"cbc not block aligned", algAES128CBC, make([]byte, aes.BlockSize+1)},
+		{"cbc bad padding", algAES128CBC, badPaddingCiphertextForTest(t, key)},
+		{"gcm too short", algAES128GCM, make([]byte, 2)},
+		{"gcm bad tag", algAES128GCM, make([]byte, 32)},
+	}
+
+	for _, c := range cases {
+		_, err := decryptBlock(c.algorithm, key, c.ciphertext)
+		if err != errDecryptionFailed {
+			t.Errorf("%s: decryptBlock() error = %v, want errDecryptionFailed", c.name, err)
+		}
+	}
+}
+
+func TestPKCS7Unpad(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    []byte
+		want    []byte
+		wantErr bool
+	}{
+		{"valid padding", append([]byte("hello"), 3, 3, 3), []byte("hello"), false},
+		{"empty input", nil, nil, true},
+		{"zero pad length", append([]byte("hello"), 0), nil, true},
+		{"pad length exceeds data", []byte{1, 1, 5}, nil, true},
+	}
+
+	for _, c := range cases {
+		got, err := pkcs7Unpad(c.data)
+		if c.wantErr {
+			if err != errDecryptionFailed {
+				t.Errorf("%s: err = %v, want errDecryptionFailed", c.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if !bytes.Equal(got, c.want) {
+			t.Errorf("%s: pkcs7Unpad() = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func encryptAESCBCForTest(t *testing.T, key, plaintext []byte) []byte {
+	t.Helper()
+	padded, err := pkcs7Pad(plaintext, aes.BlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+	return append(iv, ciphertext...)
+}
+
+func encryptAESGCMForTest(t *testing.T, key, plaintext []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil)
+}
+
+func badPaddingCiphertextForTest(t *testing.T, key []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aes.BlockSize)
+	plaintext := make([]byte, aes.BlockSize)
+	plaintext[aes.BlockSize-1] = 0xff // invalid pkcs7 pad length
+	ciphertext := make([]byte, aes.BlockSize)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+	return append(iv, ciphertext...)
+}
+
+func pkcs7Pad(data []byte, blockSize int) ([]byte, error) {
+	padLen := blockSize - len(data)%blockSize
+	padding := bytes.Repeat([]byte{byte(padLen)}, padLen)
+	return append(data, padding...), nil
+}
@@ -0,0 +1,199 @@
+package sso
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/kolide/fleet/server/kolide"
+	"github.com/pkg/errors"
+)
+
+// fakeSigner captures the content it was asked to sign instead of
+// performing real RSA signing, so tests can assert on exactly what the
+// HTTP-Redirect binding signs without depending on goxmldsig.
+type fakeSigner struct {
+	signedContent string
+	sigAlg        string
+}
+
+func (f *fakeSigner) SignString(content string) ([]byte, error) {
+	f.signedContent = content
+	return []byte("fake-signature"), nil
+}
+
+func (f *fakeSigner) SignEnveloped(el *etree.Element) (*etree.Element, error) {
+	return el, nil
+}
+
+func (f *fakeSigner) GetSignatureMethodIdentifier() string {
+	if f.sigAlg != "" {
+		return f.sigAlg
+	}
+	return "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+}
+
+func newTestLogoutHandler(signer *fakeSigner, validator Validator, terminate SessionTerminator) *logoutHandler {
+	return &logoutHandler{
+		issuer:         "https://fleet.example.com",
+		destination:    "https://idp.example.com/slo",
+		signingContext: signer,
+		validator:      validator,
+		terminate:      terminate,
+		pending:        make(map[string]logoutPending),
+	}
+}
+
+func TestLogoutRedirectURLSignedContent(t *testing.T) {
+	cases := []struct {
+		name       string
+		relayState string
+	}{
+		{"without relay state", ""},
+		{"with relay state", "/some/path"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			signer := &fakeSigner{}
+			h := newTestLogoutHandler(signer, nil, nil)
+
+			redirectURL, err := h.LogoutRedirectURL("user@example.com", "", "session-index-1", c.relayState)
+			if err != nil {
+				t.Fatalf("LogoutRedirectURL: %v", err)
+			}
+
+			parsed, err := url.Parse(redirectURL)
+			if err != nil {
+				t.Fatalf("parsing redirect url: %v", err)
+			}
+			query := parsed.Query()
+			samlRequest := query.Get("SAMLRequest")
+			sigAlg := query.Get("SigAlg")
+			if samlRequest == "" || sigAlg == "" || query.Get("Signature") == "" {
+				t.Fatalf("redirect url missing required params: %s", redirectURL)
+			}
+
+			// The signed content must be the literal, hand-built string in
+			// SAMLRequest, RelayState, SigAlg order, with SigAlg included -
+			// not query.Encode(), which alphabetizes params and was built
+			// before SigAlg existed.
+			want := "SAMLRequest=" + url.QueryEscape(samlRequest)
+			if c.relayState != "" {
+				want += "&RelayState=" + url.QueryEscape(c.relayState)
+			}
+			want += "&SigAlg=" + url.QueryEscape(sigAlg)
+
+			if signer.signedContent != want {
+				t.Errorf("signed content = %q, want %q", signer.signedContent, want)
+			}
+			if strings.Contains(signer.signedContent, "&RelayState=") && c.relayState == "" {
+				t.Errorf("signed content includes RelayState when none was given: %q", signer.signedContent)
+			}
+		})
+	}
+}
+
+func TestNewRequestNameIDFormat(t *testing.T) {
+	h := newTestLogoutHandler(&fakeSigner{}, nil, nil)
+
+	req := h.newRequest("user@example.com", "urn:oasis:names:tc:SAML:2.0:nameid-format:transient", "session-index-1")
+	if req.NameID.Format != "urn:oasis:names:tc:SAML:2.0:nameid-format:transient" {
+		t.Errorf("NameID.Format = %q, want the format passed in, not a hardcoded default", req.NameID.Format)
+	}
+
+	def := h.newRequest("user@example.com", "", "session-index-1")
+	if def.NameID.Format != "urn:oasis:names:tc:SAML:2.0:nameid-format:unspecified" {
+		t.Errorf("NameID.Format with no format given = %q, want the unspecified default", def.NameID.Format)
+	}
+}
+
+func TestFinishLogoutCorrelationAndTermination(t *testing.T) {
+	h := newTestLogoutHandler(&fakeSigner{}, nil, nil)
+	h.pending["req-1"] = logoutPending{nameID: "user@example.com", sessionIndex: "session-index-1", issuedAt: time.Now()}
+
+	var terminatedNameID, terminatedSessionIndex string
+	h.terminate = func(nameID, sessionIndex string) error {
+		terminatedNameID, terminatedSessionIndex = nameID, sessionIndex
+		return nil
+	}
+	h.validator = validateLogoutResponseFunc(func(string) (*LogoutResponse, error) {
+		return &LogoutResponse{InResponseTo: "req-1", Status: logoutStatus{StatusCode: logoutStatusCode{Value: logoutStatusSuccess}}}, nil
+	})
+
+	if err := h.FinishLogout("irrelevant"); err != nil {
+		t.Fatalf("FinishLogout: %v", err)
+	}
+	if terminatedNameID != "user@example.com" || terminatedSessionIndex != "session-index-1" {
+		t.Errorf("terminate called with (%q, %q), want (%q, %q)", terminatedNameID, terminatedSessionIndex, "user@example.com", "session-index-1")
+	}
+
+	// A second LogoutResponse for the same request no longer correlates:
+	// the pending entry was consumed by the first FinishLogout call.
+	if err := h.FinishLogout("irrelevant"); err == nil {
+		t.Error("FinishLogout on an already-consumed request should fail to correlate")
+	}
+}
+
+func TestFinishLogoutUnknownRequest(t *testing.T) {
+	h := newTestLogoutHandler(&fakeSigner{}, nil, nil)
+	h.validator = validateLogoutResponseFunc(func(string) (*LogoutResponse, error) {
+		return &LogoutResponse{InResponseTo: "never-issued", Status: logoutStatus{StatusCode: logoutStatusCode{Value: logoutStatusSuccess}}}, nil
+	})
+
+	if err := h.FinishLogout("irrelevant"); err == nil {
+		t.Error("FinishLogout for a request ID that was never issued should fail to correlate")
+	}
+}
+
+func TestFinishLogoutExpiredRequest(t *testing.T) {
+	h := newTestLogoutHandler(&fakeSigner{}, nil, nil)
+	h.pending["req-1"] = logoutPending{
+		nameID:       "user@example.com",
+		sessionIndex: "session-index-1",
+		issuedAt:     time.Now().Add(-pendingLogoutTTL - time.Minute),
+	}
+	h.validator = validateLogoutResponseFunc(func(string) (*LogoutResponse, error) {
+		return &LogoutResponse{InResponseTo: "req-1", Status: logoutStatus{StatusCode: logoutStatusCode{Value: logoutStatusSuccess}}}, nil
+	})
+
+	if err := h.FinishLogout("irrelevant"); err == nil {
+		t.Error("FinishLogout for an expired pending request should fail to correlate")
+	}
+}
+
+func TestFinishLogoutValidationError(t *testing.T) {
+	h := newTestLogoutHandler(&fakeSigner{}, nil, nil)
+	h.pending["req-1"] = logoutPending{nameID: "user@example.com", sessionIndex: "session-index-1", issuedAt: time.Now()}
+	h.terminate = func(nameID, sessionIndex string) error {
+		t.Fatal("terminate should not be called when logout response validation fails")
+		return nil
+	}
+	h.validator = validateLogoutResponseFunc(func(string) (*LogoutResponse, error) {
+		return nil, errors.New("bad signature")
+	})
+
+	if err := h.FinishLogout("irrelevant"); err == nil {
+		t.Error("FinishLogout should surface logout response validation errors")
+	}
+}
+
+// validateLogoutResponseFunc adapts a func to a Validator for testing
+// FinishLogout without needing a real IDP cert store. Its
+// ValidateSignature/ValidateResponse methods are never exercised by these
+// tests, which only drive the logout round-trip.
+type validateLogoutResponseFunc func(rawResponse string) (*LogoutResponse, error)
+
+func (f validateLogoutResponseFunc) ValidateSignature(auth kolide.Auth) (kolide.Auth, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f validateLogoutResponseFunc) ValidateResponse(auth kolide.Auth) error {
+	return errors.New("not implemented")
+}
+
+func (f validateLogoutResponseFunc) ValidateLogoutResponse(rawResponse string) (*LogoutResponse, error) {
+	return f(rawResponse)
+}
@@ -1,6 +1,7 @@
 package sso
 
 import (
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/xml"
@@ -17,12 +18,17 @@ import (
 type Validator interface {
 	ValidateSignature(auth kolide.Auth) (kolide.Auth, error)
 	ValidateResponse(auth kolide.Auth) error
+	// ValidateLogoutResponse validates the signature and timestamp of a
+	// raw, base64-encoded SAML LogoutResponse using the same IDP
+	// metadata cert store as ValidateSignature.
+	ValidateLogoutResponse(rawResponse string) (*LogoutResponse, error)
 }
 
 type validator struct {
-	context  *dsig.ValidationContext
-	clock    *dsig.Clock
-	metadata gosamltypes.EntityDescriptor
+	context       *dsig.ValidationContext
+	clock         *dsig.Clock
+	metadata      gosamltypes.EntityDescriptor
+	decryptionKey *rsa.PrivateKey
 }
 
 func Clock(clock *dsig.Clock) func(v *validator) {
@@ -31,6 +37,15 @@ func Clock(clock *dsig.Clock) func(v *validator) {
 	}
 }
 
+// DecryptionKey configures the SP private key used to decrypt
+// <saml:EncryptedAssertion> elements. Without this option, responses
+// containing encrypted assertions fail validation.
+func DecryptionKey(key *rsa.PrivateKey) func(v *validator) {
+	return func(v *validator) {
+		v.decryptionKey = key
+	}
+}
+
 // NewValidator is used to validate the response to an auth request.
 // metadata is from the IDP.
 func NewValidator(metadata string, opts ...func(v *validator)) (Validator, error) {
@@ -105,8 +120,7 @@ func (v *validator) ValidateSignature(auth kolide.Auth) (kolide.Auth, error) {
 	if err != nil || doc.Root() == nil {
 		return nil, errors.Wrap(err, "parsing xml response")
 	}
-	elt := doc.Root()
-	signed, err := v.validateSignature(elt)
+	signed, err := v.validateSignature(doc)
 	if err != nil {
 		return nil, errors.Wrap(err, "signing verification failed")
 	}
@@ -126,24 +140,94 @@ func (v *validator) ValidateSignature(auth kolide.Auth) (kolide.Auth, error) {
 	return info, nil
 }
 
-func (v *validator) validateSignature(elt *etree.Element) (*etree.Element, error) {
+// validateSignature validates doc's signature before any decryption takes
+// place, then decrypts. An IDP that signs the whole response (e.g. ADFS,
+// Azure AD) computes that signature over the still-encrypted document, so
+// checking it against a post-decryption tree would always fail; checking
+// it first and decrypting second preserves the digest the IDP actually
+// signed. When there's no envelope signature, the assertion(s) would need
+// to carry their own signature instead — but that signature, like the
+// plaintext it covers, only exists once decrypted, so there is no way to
+// establish integrity before decrypting an EncryptedAssertion in that
+// case. Decrypting attacker-controlled ciphertext before any signature
+// has been checked is a decryption oracle, so that combination is
+// rejected outright rather than decrypted.
+func (v *validator) validateSignature(doc *etree.Document) (*etree.Element, error) {
+	elt := doc.Root()
 	validated, err := v.context.Validate(elt)
-	if err == nil {
-		// If entire doc is signed, success, we're done.
-		return validated, nil
-	}
+	switch err {
+	case nil:
+		// Entire doc was signed; decrypt now that integrity is established,
+		// working on the verified copy Validate returned.
+		doc.SetRoot(validated)
+		if err := v.decryptAssertions(doc); err != nil {
+			return nil, err
+		}
+		return doc.Root(), nil
 
-	if err == dsig.ErrMissingSignature {
-		// If entire document is not signed find signed assertions, remove assertions
-		// that are not signed.
-		err = v.validateAssertionSignature(elt)
-		if err != nil {
+	case dsig.ErrMissingSignature:
+		// No envelope signature to establish integrity first: refuse to
+		// decrypt. Only plaintext assertions, validated by their own
+		// signature below, are accepted on this path.
+		if hasEncryptedAssertion(doc) {
+			return nil, errors.New("response contains an encrypted assertion but the envelope is not signed")
+		}
+		elt = doc.Root()
+		if err := v.validateAssertionSignature(elt); err != nil {
 			return nil, err
 		}
 		return elt, nil
+
+	default:
+		return nil, err
 	}
+}
+
+// hasEncryptedAssertion reports whether doc contains any
+// <saml:EncryptedAssertion> element.
+func hasEncryptedAssertion(doc *etree.Document) bool {
+	return len(doc.FindElements("//EncryptedAssertion")) > 0
+}
 
-	return nil, err
+func (v *validator) ValidateLogoutResponse(rawResponse string) (*LogoutResponse, error) {
+	decoded, err := base64.StdEncoding.DecodeString(rawResponse)
+	if err != nil {
+		return nil, errors.Wrap(err, "base64 decoding logout response")
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(decoded); err != nil || doc.Root() == nil {
+		return nil, errors.Wrap(err, "parsing logout response xml")
+	}
+	// A LogoutResponse carries no Assertion to fall back on, so unlike
+	// ValidateSignature's use of validateSignature, a missing envelope
+	// signature here is a hard rejection rather than a path to check
+	// somewhere else: v.context.Validate is called directly, and any
+	// error it returns, including dsig.ErrMissingSignature, fails closed.
+	signed, err := v.context.Validate(doc.Root())
+	if err != nil {
+		return nil, errors.Wrap(err, "logout response signature verification failed")
+	}
+	signedDoc := etree.NewDocument()
+	signedDoc.SetRoot(signed)
+	buffer, err := signedDoc.WriteToBytes()
+	if err != nil {
+		return nil, errors.Wrap(err, "creating signed logout response buffer")
+	}
+	var response LogoutResponse
+	if err := xml.Unmarshal(buffer, &response); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling logout response")
+	}
+	issueInstant, err := time.Parse(time.RFC3339, response.IssueInstant)
+	if err != nil {
+		return nil, errors.Wrap(err, "missing timestamp from logout response")
+	}
+	if v.clock.Now().Before(issueInstant.Add(-logoutResponseClockSkew)) {
+		return nil, errors.New("logout response issued in the future")
+	}
+	if response.Status.StatusCode.Value != logoutStatusSuccess {
+		return nil, errors.Errorf("logout response status %s", response.Status.StatusCode.Value)
+	}
+	return &response, nil
 }
 
 func (v *validator) validateAssertionSignature(elt *etree.Element) error {
@@ -165,4 +249,4 @@ func (v *validator) validateAssertionSignature(elt *etree.Element) error {
 		return nil
 	}
 	return etreeutils.NSFindIterate(elt, "urn:oasis:names:tc:SAML:2.0:assertion", "Assertion", validateAssertion)
-}
\ No newline at end of file
+}
@@ -0,0 +1,101 @@
+package sso
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// newTestValidator returns a validator whose IDP cert store trusts
+// keyStore's certificate, so a LogoutResponse signed with keyStore
+// validates successfully.
+func newTestValidator(t *testing.T, keyStore dsig.X509KeyStore) *validator {
+	t.Helper()
+	_, certDER, err := keyStore.GetKeyPair()
+	if err != nil {
+		t.Fatalf("GetKeyPair: %v", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatalf("parsing test cert: %v", err)
+	}
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{cert}})
+	ctx.Clock = dsig.NewRealClock()
+	return &validator{context: ctx, clock: ctx.Clock}
+}
+
+func signedLogoutResponseForTest(t *testing.T, keyStore dsig.X509KeyStore, resp LogoutResponse) string {
+	t.Helper()
+	raw, err := xml.Marshal(resp)
+	if err != nil {
+		t.Fatalf("marshalling logout response: %v", err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		t.Fatalf("parsing logout response: %v", err)
+	}
+	signed, err := dsig.NewDefaultSigningContext(keyStore).SignEnveloped(doc.Root())
+	if err != nil {
+		t.Fatalf("signing logout response: %v", err)
+	}
+	signedDoc := etree.NewDocument()
+	signedDoc.SetRoot(signed)
+	buf, err := signedDoc.WriteToBytes()
+	if err != nil {
+		t.Fatalf("serializing signed logout response: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// TestValidateLogoutResponseRequiresSignature guards against regressing the
+// LogoutResponse validation path back into validateSignature's
+// assertion-fallback behavior, which silently accepts an unsigned
+// LogoutResponse because it has no Assertion to find and reject.
+func TestValidateLogoutResponseRequiresSignature(t *testing.T) {
+	keyStore := dsig.RandomKeyStoreForTest()
+	v := newTestValidator(t, keyStore)
+
+	resp := LogoutResponse{
+		ID:           "_resp1",
+		Version:      "2.0",
+		IssueInstant: time.Now().UTC().Format(time.RFC3339),
+		InResponseTo: "_req1",
+		Issuer:       "https://idp.example.com",
+		Status:       logoutStatus{StatusCode: logoutStatusCode{Value: logoutStatusSuccess}},
+	}
+
+	t.Run("rejects unsigned response", func(t *testing.T) {
+		raw, err := xml.Marshal(resp)
+		if err != nil {
+			t.Fatalf("marshalling logout response: %v", err)
+		}
+		unsigned := base64.StdEncoding.EncodeToString(raw)
+		if _, err := v.ValidateLogoutResponse(unsigned); err == nil {
+			t.Error("ValidateLogoutResponse should reject a response with no envelope signature")
+		}
+	})
+
+	t.Run("accepts a validly signed response", func(t *testing.T) {
+		signed := signedLogoutResponseForTest(t, keyStore, resp)
+		got, err := v.ValidateLogoutResponse(signed)
+		if err != nil {
+			t.Fatalf("ValidateLogoutResponse: %v", err)
+		}
+		if got.InResponseTo != resp.InResponseTo {
+			t.Errorf("InResponseTo = %q, want %q", got.InResponseTo, resp.InResponseTo)
+		}
+	})
+
+	t.Run("rejects a response signed by an untrusted key", func(t *testing.T) {
+		otherKeyStore := dsig.RandomKeyStoreForTest()
+		signed := signedLogoutResponseForTest(t, otherKeyStore, resp)
+		if _, err := v.ValidateLogoutResponse(signed); err == nil {
+			t.Error("ValidateLogoutResponse should reject a signature from a key outside the IDP cert store")
+		}
+	})
+}